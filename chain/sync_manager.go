@@ -0,0 +1,176 @@
+package chain
+
+import (
+	"context"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	logging "github.com/ipfs/go-log"
+	"github.com/libp2p/go-libp2p-core/peer"
+	gorpc "github.com/libp2p/go-libp2p-gorpc"
+	"github.com/pkg/errors"
+)
+
+var smLog = logging.Logger("chain/syncmgr")
+
+// FastSyncProtocol is the gorpc protocol ID fast-sync requests and
+// responses travel over.
+const FastSyncProtocol = "/fil/chain/fastsync/1.0.0"
+
+// DefaultFastSyncTipsetThreshold is how far behind a bootstrap peer's
+// advertised head the local chain must be before SyncManager attempts a
+// fast sync instead of relying on normal headers-first sync.
+const DefaultFastSyncTipsetThreshold = 1500
+
+// SyncManager wraps a Syncer with an initial fast-sync phase: on startup,
+// if the local head is at least a threshold of tipsets behind the
+// configured bootstrap peer's advertised head, it requests a batched
+// range of tipset headers rooted at the genesis tipset, plus a hash
+// chain binding them to a known checkpoint CID, verifies the chain
+// before persisting anything, and then falls back to the wrapped Syncer
+// for normal operation.
+//
+// Critical invariant: SyncManager never writes a block to its blockstore
+// until the block's range hash-chains up to the trusted checkpoint, so a
+// malicious bootstrap peer cannot poison the store.
+type SyncManager struct {
+	syncer *Syncer
+	store  *Store
+	bs     bstore.Blockstore
+
+	bootstrapPeer   peer.ID
+	rpcClient       *gorpc.Client
+	checkpoint      cid.Cid
+	tipsetThreshold int
+
+	initialSyncCompleted bool
+	mu                   sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewSyncManager constructs a SyncManager that fast-syncs against
+// bootstrapPeer over rpcClient before handing off to syncer, verifying
+// any fast-synced range against checkpoint.
+func NewSyncManager(syncer *Syncer, store *Store, bs bstore.Blockstore, bootstrapPeer peer.ID, rpcClient *gorpc.Client, checkpoint cid.Cid) *SyncManager {
+	return &SyncManager{
+		syncer:          syncer,
+		store:           store,
+		bs:              bs,
+		bootstrapPeer:   bootstrapPeer,
+		rpcClient:       rpcClient,
+		checkpoint:      checkpoint,
+		tipsetThreshold: DefaultFastSyncTipsetThreshold,
+	}
+}
+
+// Start kicks off the fast-sync loop in the background. Node.Stop cancels
+// it cleanly mid-batch via Stop. If sm was constructed with no bootstrap
+// peer, there is nothing to fast sync against, so Start completes the
+// initial sync phase synchronously instead of launching a goroutine that
+// would otherwise never have anything to mark it done.
+func (sm *SyncManager) Start(ctx context.Context) {
+	if sm.bootstrapPeer == "" {
+		sm.mu.Lock()
+		sm.initialSyncCompleted = true
+		sm.mu.Unlock()
+		return
+	}
+
+	sm.ctx, sm.cancel = context.WithCancel(ctx)
+	sm.wg.Add(1)
+	go func() {
+		defer sm.wg.Done()
+		if err := sm.fastSync(sm.ctx); err != nil {
+			smLog.Warnf("fast sync against bootstrap peer %s failed, falling back to normal sync: %s", sm.bootstrapPeer, err)
+		}
+		sm.mu.Lock()
+		sm.initialSyncCompleted = true
+		sm.mu.Unlock()
+	}()
+}
+
+// Stop cancels any in-flight fast sync and waits for the loop to exit.
+func (sm *SyncManager) Stop() {
+	if sm.cancel != nil {
+		sm.cancel()
+	}
+	sm.wg.Wait()
+}
+
+// InitialSyncCompleted reports whether the fast-sync phase has finished
+// (successfully or not); normal headers-first sync takes over either way.
+func (sm *SyncManager) InitialSyncCompleted() bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.initialSyncCompleted
+}
+
+// fastSync queries the bootstrap peer's head, and if it is far enough
+// ahead of the local head, requests and verifies a batched range proof
+// covering every height from genesis (height 0) up to that head before
+// persisting it.
+func (sm *SyncManager) fastSync(ctx context.Context) error {
+	var headReply ChainHeadReply
+	if err := sm.rpcClient.Call(sm.bootstrapPeer, "SyncManagerRPC", "ChainHead", ChainHeadRequest{}, &headReply); err != nil {
+		return errors.Wrap(err, "failed to query bootstrap peer head")
+	}
+
+	localHeight, err := sm.localHeight()
+	if err != nil {
+		return errors.Wrap(err, "failed to read local head")
+	}
+
+	if headReply.Height <= localHeight || headReply.Height-localHeight < uint64(sm.tipsetThreshold) {
+		return nil
+	}
+
+	var proofReply ChainRangeProofReply
+	req := ChainRangeProofRequest{From: 0, To: headReply.Height}
+	if err := sm.rpcClient.Call(sm.bootstrapPeer, "SyncManagerRPC", "ChainRangeProof", req, &proofReply); err != nil {
+		return errors.Wrap(err, "failed to fetch chain range proof")
+	}
+
+	if !verifyRangeProof(proofReply.Leaves, proofReply.Proof, sm.checkpoint) {
+		return errors.New("bootstrap peer returned a chain range proof that does not hash up to the trusted checkpoint")
+	}
+
+	return sm.persistVerifiedRange(ctx, proofReply)
+}
+
+// persistVerifiedRange writes blocks to the blockstore only after
+// fastSync has confirmed their hash chain is anchored at the trusted
+// checkpoint; it must never be called on unverified input.
+//
+// verifyRangeProof only authenticates proof.Leaves (plus proof.Proof):
+// proof.Blocks is a separate field the bootstrap peer controls
+// independently, so each decoded block's CID is checked against its
+// corresponding, already-verified leaf before it is persisted. Without
+// this check a peer could pair a valid Leaves/Proof pair with arbitrary
+// forged Blocks.
+func (sm *SyncManager) persistVerifiedRange(ctx context.Context, proof ChainRangeProofReply) error {
+	if len(proof.Blocks) != len(proof.Leaves) {
+		return errors.New("fast sync reply has mismatched blocks and leaves counts")
+	}
+	for i, raw := range proof.Blocks {
+		blk, err := blockFromBytes(raw, proof.Leaves[i].Prefix())
+		if err != nil {
+			return errors.Wrap(err, "failed to decode fast-synced block")
+		}
+		if !blk.Cid().Equals(proof.Leaves[i]) {
+			return errors.Errorf("fast-synced block at index %d has CID %s, which does not match its verified leaf %s", i, blk.Cid(), proof.Leaves[i])
+		}
+		if err := sm.bs.Put(blk); err != nil {
+			return errors.Wrap(err, "failed to persist fast-synced block")
+		}
+	}
+	return nil
+}
+
+func (sm *SyncManager) localHeight() (uint64, error) {
+	head := sm.store.Head()
+	return head.Height()
+}
@@ -0,0 +1,75 @@
+package chain
+
+import (
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func testCid(t *testing.T, data string) cid.Cid {
+	t.Helper()
+	h, err := mh.Sum([]byte(data), mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatalf("failed to hash test data: %s", err)
+	}
+	return cid.NewCidV1(cid.Raw, h)
+}
+
+func TestVerifyRangeProofAcceptsValidChain(t *testing.T) {
+	leaves := []cid.Cid{testCid(t, "genesis"), testCid(t, "block1"), testCid(t, "block2")}
+	proof := computeRangeProof(leaves)
+
+	if !verifyRangeProof(leaves, proof, leaves[0]) {
+		t.Fatal("expected a valid hash chain rooted at the genesis leaf to verify")
+	}
+}
+
+func TestVerifyRangeProofRejectsWrongCheckpoint(t *testing.T) {
+	leaves := []cid.Cid{testCid(t, "genesis"), testCid(t, "block1")}
+	proof := computeRangeProof(leaves)
+
+	if verifyRangeProof(leaves, proof, testCid(t, "not-genesis")) {
+		t.Fatal("expected verification to fail when checkpoint doesn't match the first leaf")
+	}
+}
+
+func TestVerifyRangeProofRejectsTamperedLeaf(t *testing.T) {
+	leaves := []cid.Cid{testCid(t, "genesis"), testCid(t, "block1"), testCid(t, "block2")}
+	proof := computeRangeProof(leaves)
+
+	tampered := append([]cid.Cid{}, leaves...)
+	tampered[1] = testCid(t, "forged-block")
+
+	if verifyRangeProof(tampered, proof, leaves[0]) {
+		t.Fatal("expected verification to fail when a leaf is substituted after the proof was computed")
+	}
+}
+
+// TestVerifyRangeProofAcceptsGrowingChain is a regression test: the
+// scheme this replaced compared a hash of the entire leaf set against a
+// static checkpoint, so it could only ever match the exact range it was
+// computed against, and would reject the same genesis-rooted chain as
+// soon as the bootstrap peer's head advanced. Anchoring only on
+// leaves[0] means a longer range sharing the same genesis leaf still
+// verifies.
+func TestVerifyRangeProofAcceptsGrowingChain(t *testing.T) {
+	shortChain := []cid.Cid{testCid(t, "genesis"), testCid(t, "block1")}
+	longChain := []cid.Cid{testCid(t, "genesis"), testCid(t, "block1"), testCid(t, "block2")}
+
+	if !verifyRangeProof(shortChain, computeRangeProof(shortChain), shortChain[0]) {
+		t.Fatal("expected short chain to verify")
+	}
+	if !verifyRangeProof(longChain, computeRangeProof(longChain), longChain[0]) {
+		t.Fatal("expected a longer chain anchored at the same genesis leaf to also verify")
+	}
+}
+
+func TestVerifyRangeProofRejectsMismatchedProofLength(t *testing.T) {
+	leaves := []cid.Cid{testCid(t, "genesis"), testCid(t, "block1"), testCid(t, "block2")}
+	proof := computeRangeProof(leaves)
+
+	if verifyRangeProof(leaves, proof[:len(proof)-1], leaves[0]) {
+		t.Fatal("expected verification to fail when the proof is missing a trailing digest")
+	}
+}
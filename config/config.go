@@ -0,0 +1,43 @@
+package config
+
+// Config is the root of a node's on-disk configuration.
+type Config struct {
+	Bootstrap *BootstrapConfig
+	Swarm     *SwarmConfig
+	Pubsub    *PubsubConfig
+}
+
+// BootstrapConfig holds the addresses a node dials on startup and how
+// long it waits between bootstrap rounds.
+type BootstrapConfig struct {
+	Addresses        []string
+	MinPeerThreshold int
+	Period           string
+}
+
+// SwarmConfig holds the node's libp2p listen and public relay addresses.
+type SwarmConfig struct {
+	Address            string
+	PublicRelayAddress string
+}
+
+// PubsubConfig holds operator overrides for gossipsub peer-scoring
+// thresholds. A zero-valued field means "use net's own default for that
+// threshold" (see net.PubsubScoreParams).
+type PubsubConfig struct {
+	GossipScoreThreshold   float64
+	PublishScoreThreshold  float64
+	GraylistScoreThreshold float64
+}
+
+// NewDefaultConfig returns a Config populated with this package's
+// defaults, the way a freshly initialized repo's config.json would read.
+func NewDefaultConfig() *Config {
+	return &Config{
+		Bootstrap: &BootstrapConfig{
+			Period: "1m",
+		},
+		Swarm:  &SwarmConfig{},
+		Pubsub: &PubsubConfig{},
+	}
+}
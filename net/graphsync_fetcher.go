@@ -0,0 +1,97 @@
+package net
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-filecoin/consensus"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	graphsync "github.com/ipfs/go-graphsync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	selectorbuilder "github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/pkg/errors"
+)
+
+// GraphSyncFetcher fetches tipset blocks over graphsync. It tries
+// PeerMgr's high-scoring filecoin peers first on every fetch and falls
+// back to retrying with the next-best peer, reporting whichever peer's
+// request failed to PeerTracker so anything subscribed to it — PeerMgr,
+// in particular — can fold the failure into its own scoring.
+type GraphSyncFetcher struct {
+	exchange    graphsync.GraphExchange
+	bs          bstore.Blockstore
+	validator   *consensus.DefaultBlockValidator
+	peerTracker *PeerTracker
+	peerMgr     *PeerMgr
+}
+
+// NewGraphSyncFetcher constructs a GraphSyncFetcher. peerMgr may be nil
+// (offline mode, or a Routing that isn't a DHT), in which case fetches
+// fall back to whatever peers PeerTracker already knows about, in no
+// particular order.
+func NewGraphSyncFetcher(ctx context.Context, exchange graphsync.GraphExchange, bs bstore.Blockstore, validator *consensus.DefaultBlockValidator, peerTracker *PeerTracker, peerMgr *PeerMgr) *GraphSyncFetcher {
+	return &GraphSyncFetcher{
+		exchange:    exchange,
+		bs:          bs,
+		validator:   validator,
+		peerTracker: peerTracker,
+		peerMgr:     peerMgr,
+	}
+}
+
+// candidatePeers returns the peers a fetch should try, in priority order:
+// PeerMgr's high-scoring peers first when one is wired up, falling back
+// to PeerTracker's known peers so fetches still work offline or without
+// a DHT-backed PeerMgr.
+func (gsf *GraphSyncFetcher) candidatePeers() []peer.ID {
+	if gsf.peerMgr != nil {
+		if peers := gsf.peerMgr.HighScoringPeers(); len(peers) > 0 {
+			return peers
+		}
+	}
+	return gsf.peerTracker.List()
+}
+
+// FetchTipSetBlocks retrieves the blocks of the tipset rooted at c over
+// graphsync, trying candidate peers in priority order and reporting any
+// peer whose request fails to PeerTracker so it can be expired from
+// PeerMgr's high-scoring set.
+func (gsf *GraphSyncFetcher) FetchTipSetBlocks(ctx context.Context, c cid.Cid) ([]blocks.Block, error) {
+	var lastErr error
+	for _, p := range gsf.candidatePeers() {
+		blk, err := gsf.fetchFromPeer(ctx, p, c)
+		if err == nil {
+			return []blocks.Block{blk}, nil
+		}
+		lastErr = err
+		gsf.peerTracker.RecordFetchFailure(p)
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no peers available to fetch from")
+	}
+	return nil, errors.Wrapf(lastErr, "failed to fetch tipset %s from any peer", c)
+}
+
+// fetchFromPeer issues a single graphsync request for c's block to p,
+// using a go-ipld-prime selector that matches only the root node c (no
+// deeper traversal), and reads the result back out of the (shared)
+// blockstore graphsync writes into as it walks the response.
+func (gsf *GraphSyncFetcher) fetchFromPeer(ctx context.Context, p peer.ID, c cid.Cid) (blocks.Block, error) {
+	ssb := selectorbuilder.NewSelectorSpecBuilder(nil)
+	selector := ssb.Matcher().Node()
+
+	_, errChan := gsf.exchange.Request(ctx, p, cidlink.Link{Cid: c}, selector)
+	for err := range errChan {
+		if err != nil {
+			return nil, errors.Wrapf(err, "graphsync request to %s failed", p)
+		}
+	}
+
+	blk, err := gsf.bs.Get(c)
+	if err != nil {
+		return nil, errors.Wrapf(err, "graphsync request to %s completed but block %s is missing from the blockstore", p, c)
+	}
+	return blk, nil
+}
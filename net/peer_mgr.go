@@ -0,0 +1,280 @@
+package net
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+	"github.com/libp2p/go-libp2p-core/event"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var pmLog = logging.Logger("net/peermgr")
+
+// peerMgrDialTimeout bounds how long PeerMgr waits for an opportunistic
+// dial to a newly discovered peer before giving up on it.
+const peerMgrDialTimeout = 5 * time.Second
+
+// peerTrackerFetchFailurePenalty is how much a peer's score drops each
+// time PeerTracker reports a failed block or message fetch from it.
+const peerTrackerFetchFailurePenalty = 1
+
+// peerMgrMinPeerCheckInterval is how often PeerMgr checks whether it's
+// below MinPeerThreshold and, if so, kicks the DHT into re-bootstrapping
+// to proactively find more peers instead of waiting on identify/query
+// events alone.
+const peerMgrMinPeerCheckInterval = 30 * time.Second
+
+// Default watermarks for a PeerMgrConfig. The node builder uses them for
+// every PeerMgr it constructs; the node config has no setting for them.
+const (
+	DefaultPeerMgrMinPeers = 20
+	DefaultPeerMgrMaxPeers = 50
+)
+
+// PeerMgrConfig bounds the number of filecoin-speaking peers a PeerMgr
+// tries to maintain, distinct from the set of bootstrap peers the
+// Bootstrapper keeps connections to.
+type PeerMgrConfig struct {
+	MinPeerThreshold int
+	MaxPeerThreshold int
+}
+
+// PeerMgrStats is a snapshot of PeerMgr's view of the swarm, returned to
+// porcelain callers for diagnostics.
+type PeerMgrStats struct {
+	PeerCount int
+	MinPeers  int
+	MaxPeers  int
+	Scores    map[peer.ID]int
+}
+
+// PeerMgr maintains a target low/high watermark of filecoin-speaking
+// peers. It subscribes to libp2p identify and connectedness events plus
+// the DHT's routing table so it considers peers as soon as a query
+// discovers them, opportunistically dials newly-discovered peers that
+// advertise the FilecoinDHT protocol, and expires peers that PeerTracker
+// reports as failing block or message fetches.
+type PeerMgr struct {
+	host    host.Host
+	dht     *dht.IpfsDHT
+	tracker *PeerTracker
+	cfg     PeerMgrConfig
+
+	mu     sync.Mutex
+	scores map[peer.ID]int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewPeerMgr constructs a PeerMgr watching h for newly discovered peers
+// and dialing those that speak FilecoinDHT, using d to resolve their
+// addresses. It also subscribes to tracker so a block or message fetch
+// failure reported through tracker.RecordFetchFailure expires the
+// offending peer from PeerMgr's own scoring.
+func NewPeerMgr(h host.Host, d *dht.IpfsDHT, tracker *PeerTracker, cfg PeerMgrConfig) *PeerMgr {
+	ctx, cancel := context.WithCancel(context.Background())
+	pm := &PeerMgr{
+		host:    h,
+		dht:     d,
+		tracker: tracker,
+		cfg:     cfg,
+		scores:  make(map[peer.ID]int),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	tracker.Subscribe(func(p peer.ID) {
+		pm.PenalizePeer(p, peerTrackerFetchFailurePenalty)
+	})
+	return pm
+}
+
+// Run starts the background loop that keeps the peer count within
+// [MinPeerThreshold, MaxPeerThreshold], subscribing to identify events
+// and the DHT's routing table so it can opportunistically dial peers
+// that advertise FilecoinDHT as soon as identify or a DHT query turns
+// them up, and periodically re-bootstrapping the DHT while below
+// MinPeerThreshold so the low watermark is enforced proactively rather
+// than only waiting on whatever events happen to arrive.
+func (pm *PeerMgr) Run() error {
+	sub, err := pm.host.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted))
+	if err != nil {
+		return err
+	}
+
+	pm.host.Network().Notify(pm)
+	pm.dht.RoutingTable().PeerAdded = pm.considerPeer
+
+	pm.wg.Add(1)
+	go func() {
+		defer pm.wg.Done()
+		defer sub.Close()
+		for {
+			select {
+			case <-pm.ctx.Done():
+				return
+			case evt, ok := <-sub.Out():
+				if !ok {
+					return
+				}
+				pm.considerPeer(evt.(event.EvtPeerIdentificationCompleted).Peer)
+			}
+		}
+	}()
+
+	pm.wg.Add(1)
+	go pm.maintainMinPeers()
+
+	return nil
+}
+
+// maintainMinPeers periodically re-bootstraps the DHT while PeerMgr is
+// below MinPeerThreshold, so a node with too few peers actively seeks
+// more instead of only reacting to identify/query events it happens to
+// receive.
+func (pm *PeerMgr) maintainMinPeers() {
+	defer pm.wg.Done()
+	ticker := time.NewTicker(peerMgrMinPeerCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-pm.ctx.Done():
+			return
+		case <-ticker.C:
+			if pm.PeerCount() >= pm.cfg.MinPeerThreshold {
+				continue
+			}
+			if err := pm.dht.Bootstrap(pm.ctx); err != nil {
+				pmLog.Debugf("failed to re-bootstrap DHT while below MinPeerThreshold: %s", err)
+			}
+		}
+	}
+}
+
+// Stop tears down the background loop. It is safe to call more than
+// once.
+func (pm *PeerMgr) Stop() {
+	pm.cancel()
+	pm.host.Network().StopNotify(pm)
+	pm.wg.Wait()
+}
+
+func (pm *PeerMgr) considerPeer(p peer.ID) {
+	if pm.PeerCount() >= pm.cfg.MaxPeerThreshold {
+		return
+	}
+
+	protos, err := pm.host.Peerstore().SupportsProtocols(p, FilecoinDHT)
+	if err != nil || len(protos) == 0 {
+		return
+	}
+
+	pm.mu.Lock()
+	if _, tracked := pm.scores[p]; tracked {
+		pm.mu.Unlock()
+		return
+	}
+	pm.scores[p] = 0
+	pm.mu.Unlock()
+
+	if pm.host.Network().Connectedness(p) == network.Connected {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(pm.ctx, peerMgrDialTimeout)
+	defer cancel()
+	if err := pm.host.Connect(ctx, pm.host.Peerstore().PeerInfo(p)); err != nil {
+		pmLog.Debugf("failed to dial discovered filecoin peer %s: %s", p, err)
+		pm.mu.Lock()
+		delete(pm.scores, p)
+		pm.mu.Unlock()
+	}
+}
+
+// PenalizePeer lowers p's score by delta, as reported by PeerTracker when
+// a block or message fetch from p fails. A peer whose score drops below
+// zero is dropped so PeerMgr stops counting it toward its watermarks.
+func (pm *PeerMgr) PenalizePeer(p peer.ID, delta int) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if _, ok := pm.scores[p]; !ok {
+		return
+	}
+	pm.scores[p] -= delta
+	if pm.scores[p] < 0 {
+		delete(pm.scores, p)
+	}
+}
+
+// PeerCount returns the number of peers PeerMgr currently tracks.
+func (pm *PeerMgr) PeerCount() int {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return len(pm.scores)
+}
+
+// HighScoringPeers returns tracked peers ordered so that fetch retries can
+// prefer the ones with the best scores.
+func (pm *PeerMgr) HighScoringPeers() []peer.ID {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	peers := make([]peer.ID, 0, len(pm.scores))
+	for p := range pm.scores {
+		peers = append(peers, p)
+	}
+	sortPeersByScore(peers, pm.scores)
+	return peers
+}
+
+func sortPeersByScore(peers []peer.ID, scores map[peer.ID]int) {
+	for i := 1; i < len(peers); i++ {
+		for j := i; j > 0 && scores[peers[j]] > scores[peers[j-1]]; j-- {
+			peers[j], peers[j-1] = peers[j-1], peers[j]
+		}
+	}
+}
+
+// Stats returns a snapshot of PeerMgr's current peer counts, target
+// bounds and per-peer scores.
+func (pm *PeerMgr) Stats() PeerMgrStats {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	scores := make(map[peer.ID]int, len(pm.scores))
+	for p, s := range pm.scores {
+		scores[p] = s
+	}
+	return PeerMgrStats{
+		PeerCount: len(pm.scores),
+		MinPeers:  pm.cfg.MinPeerThreshold,
+		MaxPeers:  pm.cfg.MaxPeerThreshold,
+		Scores:    scores,
+	}
+}
+
+// Listen, ListenClose, Connected, Disconnected, OpenedStream and
+// ClosedStream implement network.Notifiee so PeerMgr learns about new
+// connections as they happen, not only from identify events.
+func (pm *PeerMgr) Listen(network.Network, ma.Multiaddr)      {}
+func (pm *PeerMgr) ListenClose(network.Network, ma.Multiaddr) {}
+
+func (pm *PeerMgr) Connected(n network.Network, c network.Conn) {
+	pm.considerPeer(c.RemotePeer())
+}
+
+func (pm *PeerMgr) Disconnected(n network.Network, c network.Conn) {
+	pm.mu.Lock()
+	delete(pm.scores, c.RemotePeer())
+	pm.mu.Unlock()
+}
+
+func (pm *PeerMgr) OpenedStream(network.Network, network.Stream) {}
+func (pm *PeerMgr) ClosedStream(network.Network, network.Stream) {}
@@ -0,0 +1,74 @@
+package net
+
+import (
+	"sync"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// PeerTracker records which peers have recently served graphsync/bitswap
+// fetches, independent of PeerMgr's own identify- and DHT-driven
+// watermark bookkeeping. GraphSyncFetcher consults it as a fallback peer
+// source when no PeerMgr is wired up (offline mode, or a non-DHT
+// Routing), and reports per-fetch failures into it so anything
+// subscribed — PeerMgr, in particular — can fold that feedback into its
+// own scoring without GraphSyncFetcher depending on PeerMgr directly.
+type PeerTracker struct {
+	mu        sync.Mutex
+	peers     map[peer.ID]struct{}
+	observers []func(peer.ID)
+}
+
+// NewPeerTracker constructs an empty PeerTracker.
+func NewPeerTracker() *PeerTracker {
+	return &PeerTracker{peers: make(map[peer.ID]struct{})}
+}
+
+// Track records p as a peer worth considering for future fetches.
+func (pt *PeerTracker) Track(p peer.ID) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.peers[p] = struct{}{}
+}
+
+// Untrack removes p, e.g. once it has been expired for repeated fetch
+// failures.
+func (pt *PeerTracker) Untrack(p peer.ID) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	delete(pt.peers, p)
+}
+
+// List returns every peer PeerTracker currently knows about, in no
+// particular order.
+func (pt *PeerTracker) List() []peer.ID {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	peers := make([]peer.ID, 0, len(pt.peers))
+	for p := range pt.peers {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+// Subscribe registers fn to be called every time RecordFetchFailure
+// reports a failed fetch from some peer.
+func (pt *PeerTracker) Subscribe(fn func(peer.ID)) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.observers = append(pt.observers, fn)
+}
+
+// RecordFetchFailure reports that a block or message fetch from p
+// failed, notifying every subscriber so they can expire or otherwise
+// penalize p.
+func (pt *PeerTracker) RecordFetchFailure(p peer.ID) {
+	pt.mu.Lock()
+	observers := make([]func(peer.ID), len(pt.observers))
+	copy(observers, pt.observers)
+	pt.mu.Unlock()
+
+	for _, observer := range observers {
+		observer(p)
+	}
+}
@@ -0,0 +1,39 @@
+package net
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestPeerTrackerTrackUntrackList(t *testing.T) {
+	pt := NewPeerTracker()
+	p := peer.ID("peer-a")
+
+	pt.Track(p)
+	if list := pt.List(); len(list) != 1 || list[0] != p {
+		t.Fatalf("expected Track to add the peer, got %v", list)
+	}
+
+	pt.Untrack(p)
+	if list := pt.List(); len(list) != 0 {
+		t.Fatalf("expected Untrack to remove the peer, got %v", list)
+	}
+}
+
+// TestPeerTrackerRecordFetchFailureNotifiesSubscribers is a regression
+// test: fetch failures used to only ever reach PeerMgr directly from
+// GraphSyncFetcher, with no path through PeerTracker at all.
+func TestPeerTrackerRecordFetchFailureNotifiesSubscribers(t *testing.T) {
+	pt := NewPeerTracker()
+	p := peer.ID("peer-a")
+
+	var notified peer.ID
+	pt.Subscribe(func(reported peer.ID) { notified = reported })
+
+	pt.RecordFetchFailure(p)
+
+	if notified != p {
+		t.Fatalf("expected subscriber to be notified of failure for %s, got %s", p, notified)
+	}
+}
@@ -0,0 +1,104 @@
+package net
+
+import (
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+// defaultPeerScoreThresholds are applied whenever the repo config leaves a
+// threshold at its zero value: permissive enough that gossipsub does not
+// start throttling or graylisting peers until their behavior is clearly
+// abusive.
+var defaultPeerScoreThresholds = pubsub.PeerScoreThresholds{
+	GossipThreshold:             -500,
+	PublishThreshold:            -1000,
+	GraylistThreshold:           -2500,
+	AcceptPXThreshold:           1000,
+	OpportunisticGraftThreshold: 3.5,
+}
+
+// PubsubScoreParams builds the gossipsub peer-scoring parameters and
+// thresholds newPubSub passes to pubsub.WithPeerScore, layering the
+// operator's overrides from config.Pubsub on top of
+// defaultPeerScoreThresholds. The block topic is the only one scored
+// directly; all other signals (invalid message rate, IP colocation, etc.)
+// use gossipsub's own built-in defaults.
+func PubsubScoreParams(cfg *config.PubsubConfig, blockTopic string) (*pubsub.PeerScoreParams, *pubsub.PeerScoreThresholds) {
+	thresholds := defaultPeerScoreThresholds
+	if cfg != nil {
+		if cfg.GossipScoreThreshold != 0 {
+			thresholds.GossipThreshold = cfg.GossipScoreThreshold
+		}
+		if cfg.PublishScoreThreshold != 0 {
+			thresholds.PublishThreshold = cfg.PublishScoreThreshold
+		}
+		if cfg.GraylistScoreThreshold != 0 {
+			thresholds.GraylistThreshold = cfg.GraylistScoreThreshold
+		}
+	}
+
+	params := &pubsub.PeerScoreParams{
+		Topics: map[string]*pubsub.TopicScoreParams{
+			blockTopic: {
+				TopicWeight:                    1,
+				TimeInMeshWeight:               0.01,
+				TimeInMeshQuantum:              time.Second,
+				TimeInMeshCap:                  10,
+				FirstMessageDeliveriesWeight:   1,
+				FirstMessageDeliveriesDecay:    0.9,
+				FirstMessageDeliveriesCap:      100,
+				InvalidMessageDeliveriesWeight: -100,
+				InvalidMessageDeliveriesDecay:  0.9,
+			},
+		},
+		AppSpecificScore: func(p peer.ID) float64 { return 0 },
+		DecayInterval:    time.Second,
+		DecayToZero:      0.01,
+	}
+
+	return params, &thresholds
+}
+
+// PubsubScoreTracker records the most recent per-peer gossipsub scores
+// reported through pubsub.WithPeerScoreInspect, since pubsub.PubSub itself
+// has no public accessor for a peer's current score.
+type PubsubScoreTracker struct {
+	mu     sync.Mutex
+	scores map[peer.ID]float64
+}
+
+// NewPubsubScoreTracker constructs an empty PubsubScoreTracker.
+func NewPubsubScoreTracker() *PubsubScoreTracker {
+	return &PubsubScoreTracker{scores: make(map[peer.ID]float64)}
+}
+
+// Inspect is passed to pubsub.WithPeerScoreInspect and replaces the
+// tracked snapshot on every inspection interval.
+func (t *PubsubScoreTracker) Inspect(scores map[peer.ID]float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.scores = scores
+}
+
+// PeerScore returns peer p's most recently reported score, if any.
+func (t *PubsubScoreTracker) PeerScore(p peer.ID) (float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.scores[p]
+	return s, ok
+}
+
+// Scores returns a copy of the most recent score snapshot for all peers.
+func (t *PubsubScoreTracker) Scores() map[peer.ID]float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[peer.ID]float64, len(t.scores))
+	for p, s := range t.scores {
+		out[p] = s
+	}
+	return out
+}
@@ -0,0 +1,97 @@
+package node
+
+import (
+	mafilter "github.com/libp2p/go-maddr-filter"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/pkg/errors"
+	mamask "github.com/whyrusleeping/multiaddr-filter"
+)
+
+// buildAddrsFactory composes the current relay address logic with the
+// configured address filters and announce/no-announce lists into a
+// single libp2p AddrsFactory: operators behind NAT or on multi-homed
+// hosts can publish only the addresses they want, while relay nodes keep
+// announcing their public relay address as before. filters additionally
+// scrubs denied addresses out of what gets announced; it's the same
+// *mafilter.Filters the caller passes to libp2p.Filters to also stop the
+// host from dialing or accepting connections on them.
+func (nc *Config) buildAddrsFactory(publicRelayAddr ma.Multiaddr, filters *mafilter.Filters) (func([]ma.Multiaddr) []ma.Multiaddr, error) {
+	announce, err := parseMultiaddrs(nc.AnnounceAddrs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse announce addresses")
+	}
+	noAnnounce, err := parseMultiaddrs(nc.NoAnnounceAddrs)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse no-announce addresses")
+	}
+
+	return func(addrs []ma.Multiaddr) []ma.Multiaddr {
+		out := addrs
+		if len(announce) > 0 {
+			out = announce
+		}
+		if publicRelayAddr != nil {
+			out = append(out, publicRelayAddr)
+		}
+		out = filterAddrs(out, filters)
+		out = removeAddrs(out, noAnnounce)
+		return out
+	}, nil
+}
+
+// parseAddrFilters parses multiaddr masks (CIDR-style, e.g.
+// "/ip4/10.0.0.0/ipcidr/8") into a Filters set that denies matching
+// addresses.
+func parseAddrFilters(masks []string) (*mafilter.Filters, error) {
+	filters := mafilter.NewFilters()
+	for _, m := range masks {
+		mask, err := mamask.NewMask(m)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid address filter %q", m)
+		}
+		filters.AddFilter(*mask, mafilter.ActionDeny)
+	}
+	return filters, nil
+}
+
+func parseMultiaddrs(raw []string) ([]ma.Multiaddr, error) {
+	out := make([]ma.Multiaddr, 0, len(raw))
+	for _, s := range raw {
+		addr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid multiaddr %q", s)
+		}
+		out = append(out, addr)
+	}
+	return out, nil
+}
+
+func filterAddrs(addrs []ma.Multiaddr, filters *mafilter.Filters) []ma.Multiaddr {
+	out := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		if !filters.AddrBlocked(a) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func removeAddrs(addrs []ma.Multiaddr, remove []ma.Multiaddr) []ma.Multiaddr {
+	if len(remove) == 0 {
+		return addrs
+	}
+	out := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		blocked := false
+		for _, r := range remove {
+			if a.Equal(r) {
+				blocked = true
+				break
+			}
+		}
+		if !blocked {
+			out = append(out, a)
+		}
+	}
+	return out
+}
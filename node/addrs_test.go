@@ -0,0 +1,94 @@
+package node
+
+import (
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func mustAddr(t *testing.T, s string) ma.Multiaddr {
+	t.Helper()
+	a, err := ma.NewMultiaddr(s)
+	if err != nil {
+		t.Fatalf("invalid test multiaddr %q: %s", s, err)
+	}
+	return a
+}
+
+// TestBuildAddrsFactoryUnionsRelayAddrIntoAnnounceList is a regression
+// test: the factory used to overwrite the announce set with
+// AnnounceAddrs unconditionally, discarding the relay's public address
+// computed earlier in the same closure. A relay node with AnnounceAddrs
+// configured must keep announcing its public relay address.
+func TestBuildAddrsFactoryUnionsRelayAddrIntoAnnounceList(t *testing.T) {
+	nc := &Config{AnnounceAddrs: []string{"/ip4/1.2.3.4/tcp/4001"}}
+	relay := mustAddr(t, "/ip4/5.6.7.8/tcp/4001")
+
+	filters, err := parseAddrFilters(nc.AddrFilters)
+	if err != nil {
+		t.Fatalf("parseAddrFilters: %s", err)
+	}
+	factory, err := nc.buildAddrsFactory(relay, filters)
+	if err != nil {
+		t.Fatalf("buildAddrsFactory: %s", err)
+	}
+
+	out := factory(nil)
+
+	var sawAnnounce, sawRelay bool
+	for _, a := range out {
+		if a.Equal(mustAddr(t, "/ip4/1.2.3.4/tcp/4001")) {
+			sawAnnounce = true
+		}
+		if a.Equal(relay) {
+			sawRelay = true
+		}
+	}
+	if !sawAnnounce {
+		t.Error("expected configured announce address in factory output")
+	}
+	if !sawRelay {
+		t.Error("expected public relay address to survive alongside AnnounceAddrs, not be overwritten")
+	}
+}
+
+func TestBuildAddrsFactoryAppliesFiltersAndNoAnnounce(t *testing.T) {
+	nc := &Config{
+		AddrFilters:     []string{"/ip4/10.0.0.0/ipcidr/8"},
+		NoAnnounceAddrs: []string{"/ip4/192.168.1.1/tcp/4001"},
+	}
+	filters, err := parseAddrFilters(nc.AddrFilters)
+	if err != nil {
+		t.Fatalf("parseAddrFilters: %s", err)
+	}
+	factory, err := nc.buildAddrsFactory(nil, filters)
+	if err != nil {
+		t.Fatalf("buildAddrsFactory: %s", err)
+	}
+
+	in := []ma.Multiaddr{
+		mustAddr(t, "/ip4/10.1.2.3/tcp/4001"),
+		mustAddr(t, "/ip4/192.168.1.1/tcp/4001"),
+		mustAddr(t, "/ip4/8.8.8.8/tcp/4001"),
+	}
+	out := factory(in)
+
+	for _, a := range out {
+		if a.Equal(mustAddr(t, "/ip4/10.1.2.3/tcp/4001")) {
+			t.Error("expected filtered address to be dropped")
+		}
+		if a.Equal(mustAddr(t, "/ip4/192.168.1.1/tcp/4001")) {
+			t.Error("expected no-announce address to be dropped")
+		}
+	}
+
+	var sawKept bool
+	for _, a := range out {
+		if a.Equal(mustAddr(t, "/ip4/8.8.8.8/tcp/4001")) {
+			sawKept = true
+		}
+	}
+	if !sawKept {
+		t.Error("expected unfiltered address to survive")
+	}
+}
@@ -4,50 +4,28 @@ import (
 	"context"
 	"time"
 
-	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/clock"
 	"github.com/filecoin-project/go-filecoin/consensus"
-	"github.com/filecoin-project/go-filecoin/core"
 	"github.com/filecoin-project/go-filecoin/net"
-	"github.com/filecoin-project/go-filecoin/net/pubsub"
-	"github.com/filecoin-project/go-filecoin/plumbing"
-	"github.com/filecoin-project/go-filecoin/plumbing/cfg"
-	"github.com/filecoin-project/go-filecoin/plumbing/cst"
-	"github.com/filecoin-project/go-filecoin/plumbing/dag"
-	"github.com/filecoin-project/go-filecoin/plumbing/msg"
-	"github.com/filecoin-project/go-filecoin/plumbing/strgdls"
-	"github.com/filecoin-project/go-filecoin/porcelain"
 	"github.com/filecoin-project/go-filecoin/proofs/verification"
 	"github.com/filecoin-project/go-filecoin/repo"
-	"github.com/filecoin-project/go-filecoin/state"
-	"github.com/filecoin-project/go-filecoin/util/moresync"
-	"github.com/filecoin-project/go-filecoin/version"
-	"github.com/filecoin-project/go-filecoin/wallet"
-	"github.com/ipfs/go-bitswap"
-	bsnet "github.com/ipfs/go-bitswap/network"
-	bserv "github.com/ipfs/go-blockservice"
-	"github.com/ipfs/go-graphsync"
-	"github.com/ipfs/go-graphsync/ipldbridge"
-	gsnet "github.com/ipfs/go-graphsync/network"
-	gsstoreutil "github.com/ipfs/go-graphsync/storeutil"
-	"github.com/ipfs/go-hamt-ipld"
-	bstore "github.com/ipfs/go-ipfs-blockstore"
-	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
 	offroute "github.com/ipfs/go-ipfs-routing/offline"
-	"github.com/ipfs/go-merkledag"
 	libp2p "github.com/libp2p/go-libp2p"
 	autonatsvc "github.com/libp2p/go-libp2p-autonat-svc"
 	circuit "github.com/libp2p/go-libp2p-circuit"
 	"github.com/libp2p/go-libp2p-core/host"
 	p2pmetrics "github.com/libp2p/go-libp2p-core/metrics"
+	"github.com/libp2p/go-libp2p-core/protocol"
 	"github.com/libp2p/go-libp2p-core/routing"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
 	dhtopts "github.com/libp2p/go-libp2p-kad-dht/opts"
-	libp2pps "github.com/libp2p/go-libp2p-pubsub"
+	record "github.com/libp2p/go-libp2p-record"
 	rhost "github.com/libp2p/go-libp2p/p2p/host/routed"
-	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/pkg/errors"
+	"go.uber.org/fx"
 )
 
 // Config is a helper to aid in the construction of a filecoin node.
@@ -61,8 +39,22 @@ type Config struct {
 	Repo        repo.Repo
 	IsRelay     bool
 	Clock       clock.Clock
+	Checkpoint  cid.Cid
+
+	AddrFilters     []string
+	AnnounceAddrs   []string
+	NoAnnounceAddrs []string
+
+	Routing RoutingOption
 }
 
+// RoutingOption constructs the routing.Routing implementation a node's
+// host uses to discover peers and provider records. When unset, the
+// default is a full Kademlia DHT restricted to peers speaking the
+// FilecoinDHT protocol; tests and lightweight clients can supply their
+// own, e.g. a DHT client-only router.
+type RoutingOption func(ctx context.Context, h host.Host, ds ds.Batching, validator record.Validator, protocols ...protocol.ID) (routing.Routing, error)
+
 // ConfigOpt is a configuration option for a filecoin node.
 type ConfigOpt func(*Config) error
 
@@ -126,215 +118,135 @@ func ClockConfigOption(clk clock.Clock) ConfigOpt {
 	}
 }
 
-// New creates a new node.
-func New(ctx context.Context, opts ...ConfigOpt) (*Node, error) {
-	n := &Config{}
-	for _, o := range opts {
-		if err := o(n); err != nil {
-			return nil, err
-		}
+// CheckpointConfigOption sets the CID (the genesis tipset's) that the
+// first leaf of a chain.SyncManager's bootstrap fast-sync range must
+// equal before the range is trusted.
+func CheckpointConfigOption(checkpoint cid.Cid) ConfigOpt {
+	return func(c *Config) error {
+		c.Checkpoint = checkpoint
+		return nil
 	}
-
-	return n.build(ctx)
 }
 
-// Build instantiates a filecoin Node from the settings specified in the config.
-func (nc *Config) build(ctx context.Context) (*Node, error) {
-	if nc.Repo == nil {
-		nc.Repo = repo.NewInMemoryRepo()
-	}
-	if nc.Clock == nil {
-		nc.Clock = clock.NewSystemClock()
+// AddrFilters sets multiaddr masks (see whyrusleeping/multiaddr-filter)
+// of addresses the host should never dial or accept connections from.
+func AddrFilters(filters []string) ConfigOpt {
+	return func(c *Config) error {
+		c.AddrFilters = filters
+		return nil
 	}
+}
 
-	bs := bstore.NewBlockstore(nc.Repo.Datastore())
-
-	validator := blankValidator{}
-
-	var peerHost host.Host
-	var router routing.Routing
-
-	bandwidthTracker := p2pmetrics.NewBandwidthCounter()
-	nc.Libp2pOpts = append(nc.Libp2pOpts, libp2p.BandwidthReporter(bandwidthTracker))
-
-	if !nc.OfflineMode {
-		makeDHT := func(h host.Host) (routing.Routing, error) {
-			r, err := dht.New(
-				ctx,
-				h,
-				dhtopts.Datastore(nc.Repo.Datastore()),
-				dhtopts.NamespacedValidator("v", validator),
-				dhtopts.Protocols(net.FilecoinDHT),
-			)
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to setup routing")
-			}
-			router = r
-			return r, err
-		}
-
-		var err error
-		peerHost, err = nc.buildHost(ctx, makeDHT)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		router = offroute.NewOfflineRouter(nc.Repo.Datastore(), validator)
-		peerHost = rhost.Wrap(noopLibP2PHost{}, router)
+// AnnounceAddrs sets the multiaddrs the host announces to the network in
+// place of its observed listen addresses.
+func AnnounceAddrs(addrs []string) ConfigOpt {
+	return func(c *Config) error {
+		c.AnnounceAddrs = addrs
+		return nil
 	}
+}
 
-	// set up pinger
-	pingService := ping.NewPingService(peerHost)
-
-	// setup block validation
-	// TODO when #2961 is resolved do the needful here.
-	blkValid := consensus.NewDefaultBlockValidator(nc.BlockTime, nc.Clock)
-
-	// set up peer tracking
-	peerTracker := net.NewPeerTracker()
+// NoAnnounceAddrs sets the multiaddrs the host should never announce,
+// even if it is listening on them.
+func NoAnnounceAddrs(addrs []string) ConfigOpt {
+	return func(c *Config) error {
+		c.NoAnnounceAddrs = addrs
+		return nil
+	}
+}
 
-	// set up bitswap
-	nwork := bsnet.NewFromIpfsHost(peerHost, router)
-	//nwork := bsnet.NewFromIpfsHost(innerHost, router)
-	bswap := bitswap.New(ctx, nwork, bs)
-	bservice := bserv.New(bs, bswap)
+// RoutingConfigOption overrides the default full DHT routing with an
+// arbitrary RoutingOption.
+func RoutingConfigOption(ro RoutingOption) ConfigOpt {
+	return func(c *Config) error {
+		c.Routing = ro
+		return nil
+	}
+}
 
-	graphsyncNetwork := gsnet.NewFromLibp2pHost(peerHost)
-	bridge := ipldbridge.NewIPLDBridge()
-	loader := gsstoreutil.LoaderForBlockstore(bs)
-	storer := gsstoreutil.StorerForBlockstore(bs)
-	gsync := graphsync.New(ctx, graphsyncNetwork, bridge, loader, storer)
-	fetcher := net.NewGraphSyncFetcher(ctx, gsync, bs, blkValid, peerTracker)
+// New creates a new node, assembling its dependency graph with fx under
+// the hood. This is equivalent to NewWithOptions(ctx, Options(opts...))
+// and remains the entry point most callers should use.
+func New(ctx context.Context, opts ...ConfigOpt) (*Node, error) {
+	return NewWithOptions(ctx, Options(opts...))
+}
 
-	ipldCborStore := hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
-	genCid, err := readGenesisCid(nc.Repo.Datastore())
-	if err != nil {
+// NewWithOptions builds a Node from an arbitrary fx.Option graph, letting
+// callers layer Override or extra fx.Provide/fx.Replace/fx.Decorate
+// options on top of the defaults returned by Options. Test harnesses use
+// this to swap individual subsystems (e.g. node.Override(new(consensus.Protocol),
+// myConsensus)) without reimplementing the rest of the graph.
+func NewWithOptions(ctx context.Context, opt fx.Option) (*Node, error) {
+	var nd *Node
+	app := fx.New(opt, fx.Populate(&nd), fx.NopLogger)
+	if err := app.Err(); err != nil {
 		return nil, err
 	}
-
-	chainStatusReporter := chain.NewStatusReporter()
-	// set up chain and message stores
-	chainStore := chain.NewStore(nc.Repo.ChainDatastore(), &ipldCborStore, &state.TreeStateLoader{}, chainStatusReporter, genCid)
-	messageStore := chain.NewMessageStore(&ipldCborStore)
-	chainState := cst.NewChainStateProvider(chainStore, messageStore, &ipldCborStore)
-	powerTable := &consensus.MarketView{}
-
-	// create protocol upgrade table
-	network, err := networkNameFromGenesis(ctx, chainStore, bs)
-	if err != nil {
+	if err := app.Start(ctx); err != nil {
 		return nil, err
 	}
+	nd.app = app
+	return nd, nil
+}
 
-	// TODO: inject protocol upgrade table into code that requires it (#3360)
-	_, err = version.ConfigureProtocolVersions(network)
+// parseBootstrapPeriod parses the bootstrap period duration read from the
+// repo config, wrapping the error with context the way the rest of this
+// package does for repo-config-derived values.
+func parseBootstrapPeriod(periodStr string) (time.Duration, error) {
+	period, err := time.ParseDuration(periodStr)
 	if err != nil {
-		return nil, err
+		return 0, errors.Wrapf(err, "couldn't parse bootstrap period %s", periodStr)
 	}
+	return period, nil
+}
 
-	// set up processor
-	var processor consensus.Processor
-	if nc.Rewarder == nil {
-		processor = consensus.NewDefaultProcessor()
-	} else {
-		processor = consensus.NewConfiguredProcessor(consensus.NewDefaultMessageValidator(), nc.Rewarder)
-	}
+// defaultRouting is the RoutingOption used when a Config does not supply
+// its own: a full Kademlia DHT namespaced to peers that speak the
+// requested protocols (net.FilecoinDHT in practice).
+func defaultRouting(ctx context.Context, h host.Host, datastore ds.Batching, validator record.Validator, protocols ...protocol.ID) (routing.Routing, error) {
+	return dht.New(
+		ctx,
+		h,
+		dhtopts.Datastore(datastore),
+		dhtopts.NamespacedValidator("v", validator),
+		dhtopts.Protocols(protocols...),
+	)
+}
 
-	// set up consensus
-	var nodeConsensus consensus.Protocol
-	if nc.Verifier == nil {
-		nodeConsensus = consensus.NewExpected(&ipldCborStore, bs, processor, blkValid, powerTable, genCid, &verification.RustVerifier{}, nc.BlockTime)
-	} else {
-		nodeConsensus = consensus.NewExpected(&ipldCborStore, bs, processor, blkValid, powerTable, genCid, nc.Verifier, nc.BlockTime)
-	}
+// buildHostAndRouter determines if we are publically dialable and builds
+// the libp2p host plus its routing table accordingly. If so use public
+// Address, if not configure node to announce relay address. Offline mode
+// skips libp2p entirely in favor of an offline router and a no-op host.
+func (nc *Config) buildHostAndRouter(ctx context.Context, validator record.Validator) (host.Host, routing.Routing, *p2pmetrics.BandwidthCounter, error) {
+	bandwidthTracker := p2pmetrics.NewBandwidthCounter()
 
-	// Set up libp2p network
-	// TODO PubSub requires strict message signing, disabled for now
-	// reference issue: #3124
-	fsub, err := libp2pps.NewFloodSub(ctx, peerHost, libp2pps.WithMessageSigning(false))
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to set up network")
-	}
-	// register block validation on floodsub
-	btv := net.NewBlockTopicValidator(blkValid)
-	if err := fsub.RegisterTopicValidator(btv.Topic(), btv.Validator(), btv.Opts()...); err != nil {
-		return nil, errors.Wrap(err, "failed to register block validator")
+	if nc.OfflineMode {
+		router := offroute.NewOfflineRouter(nc.Repo.Datastore(), validator)
+		return rhost.Wrap(noopLibP2PHost{}, router), router, bandwidthTracker, nil
 	}
 
-	backend, err := wallet.NewDSBackend(nc.Repo.WalletDatastore())
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to set up wallet backend")
-	}
-	fcWallet := wallet.New(backend)
-
-	// only the syncer gets the storage which is online connected
-	chainSyncer := chain.NewSyncer(nodeConsensus, chainStore, messageStore, fetcher, chainStatusReporter, nc.Clock)
-	msgPool := core.NewMessagePool(nc.Repo.Config().Mpool, consensus.NewIngestionValidator(chainState, nc.Repo.Config().Mpool))
-	inbox := core.NewInbox(msgPool, core.InboxMaxAgeTipsets, chainStore, messageStore)
-
-	msgQueue := core.NewMessageQueue()
-	outboxPolicy := core.NewMessageQueuePolicy(messageStore, core.OutboxMaxAgeRounds)
-	msgPublisher := core.NewDefaultMessagePublisher(pubsub.NewPublisher(fsub), net.MessageTopic, msgPool)
-	outbox := core.NewOutbox(fcWallet, consensus.NewOutboundMessageValidator(), msgQueue, msgPublisher, outboxPolicy, chainStore, chainState)
-
-	nd := &Node{
-		blockservice: bservice,
-		Blockstore:   bs,
-		cborStore:    &ipldCborStore,
-		Clock:        nc.Clock,
-		Consensus:    nodeConsensus,
-		ChainReader:  chainStore,
-		ChainSynced:  moresync.NewLatch(1),
-		MessageStore: messageStore,
-		Syncer:       chainSyncer,
-		PowerTable:   powerTable,
-		PeerTracker:  peerTracker,
-		Fetcher:      fetcher,
-		Exchange:     bswap,
-		host:         peerHost,
-		Inbox:        inbox,
-		OfflineMode:  nc.OfflineMode,
-		Outbox:       outbox,
-		PeerHost:     peerHost,
-		Repo:         nc.Repo,
-		Wallet:       fcWallet,
-		Router:       router,
+	routingOpt := nc.Routing
+	if routingOpt == nil {
+		routingOpt = defaultRouting
 	}
 
-	nd.PorcelainAPI = porcelain.New(plumbing.New(&plumbing.APIDeps{
-		Bitswap:       bswap,
-		Chain:         chainState,
-		Sync:          cst.NewChainSyncProvider(chainSyncer),
-		Config:        cfg.NewConfig(nc.Repo),
-		DAG:           dag.NewDAG(merkledag.NewDAGService(bservice)),
-		Deals:         strgdls.New(nc.Repo.DealsDatastore()),
-		Expected:      nodeConsensus,
-		MsgPool:       msgPool,
-		MsgPreviewer:  msg.NewPreviewer(chainStore, &ipldCborStore, bs),
-		MsgQueryer:    msg.NewQueryer(chainStore, &ipldCborStore, bs),
-		MsgWaiter:     msg.NewWaiter(chainStore, messageStore, bs, &ipldCborStore),
-		Network:       net.New(peerHost, pubsub.NewPublisher(fsub), pubsub.NewSubscriber(fsub), net.NewRouter(router), bandwidthTracker, net.NewPinger(peerHost, pingService)),
-		Outbox:        outbox,
-		SectorBuilder: nd.SectorBuilder,
-		Wallet:        fcWallet,
-	}))
-
-	// Bootstrapping network peers.
-	periodStr := nd.Repo.Config().Bootstrap.Period
-	period, err := time.ParseDuration(periodStr)
-	if err != nil {
-		return nil, errors.Wrapf(err, "couldn't parse bootstrap period %s", periodStr)
+	var router routing.Routing
+	makeDHT := func(h host.Host) (routing.Routing, error) {
+		r, err := routingOpt(ctx, h, nc.Repo.Datastore(), validator, net.FilecoinDHT)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to setup routing")
+		}
+		router = r
+		return r, err
 	}
 
-	// Bootstrapper maintains connections to some subset of addresses
-	ba := nd.Repo.Config().Bootstrap.Addresses
-	bpi, err := net.PeerAddrsToAddrInfo(ba)
+	nc.Libp2pOpts = append(nc.Libp2pOpts, libp2p.BandwidthReporter(bandwidthTracker))
+
+	h, err := nc.buildHost(ctx, makeDHT)
 	if err != nil {
-		return nil, errors.Wrapf(err, "couldn't parse bootstrap addresses [%s]", ba)
+		return nil, nil, nil, err
 	}
-	minPeerThreshold := nd.Repo.Config().Bootstrap.MinPeerThreshold
-	nd.Bootstrapper = net.NewBootstrapper(bpi, nd.Host(), nd.Host().Network(), nd.Router, minPeerThreshold, period)
-
-	return nd, nil
+	return h, router, bandwidthTracker, nil
 }
 
 // buildHost determines if we are publically dialable.  If so use public
@@ -347,19 +259,27 @@ func (nc *Config) buildHost(ctx context.Context, makeDHT func(host host.Host) (r
 		return makeDHT(h)
 	}
 
+	filters, err := parseAddrFilters(nc.AddrFilters)
+	if err != nil {
+		return nil, err
+	}
+
 	if nc.IsRelay {
 		cfg := nc.Repo.Config()
-		publicAddr, err := ma.NewMultiaddr(cfg.Swarm.PublicRelayAddress)
+		var publicAddr ma.Multiaddr
+		if cfg.Swarm.PublicRelayAddress != "" {
+			var err error
+			publicAddr, err = ma.NewMultiaddr(cfg.Swarm.PublicRelayAddress)
+			if err != nil {
+				return nil, err
+			}
+		}
+		addrsFactory, err := nc.buildAddrsFactory(publicAddr, filters)
 		if err != nil {
 			return nil, err
 		}
-		publicAddrFactory := func(lc *libp2p.Config) error {
-			lc.AddrsFactory = func(addrs []ma.Multiaddr) []ma.Multiaddr {
-				if cfg.Swarm.PublicRelayAddress == "" {
-					return addrs
-				}
-				return append(addrs, publicAddr)
-			}
+		addrsFactoryOpt := func(lc *libp2p.Config) error {
+			lc.AddrsFactory = addrsFactory
 			return nil
 		}
 		relayHost, err := libp2p.New(
@@ -367,7 +287,8 @@ func (nc *Config) buildHost(ctx context.Context, makeDHT func(host host.Host) (r
 			libp2p.EnableRelay(circuit.OptHop),
 			libp2p.EnableAutoRelay(),
 			libp2p.Routing(makeDHTRightType),
-			publicAddrFactory,
+			addrsFactoryOpt,
+			libp2p.Filters(filters),
 			libp2p.ChainOptions(nc.Libp2pOpts...),
 		)
 		if err != nil {
@@ -380,10 +301,21 @@ func (nc *Config) buildHost(ctx context.Context, makeDHT func(host host.Host) (r
 		}
 		return relayHost, nil
 	}
+
+	addrsFactory, err := nc.buildAddrsFactory(nil, filters)
+	if err != nil {
+		return nil, err
+	}
+	addrsFactoryOpt := func(lc *libp2p.Config) error {
+		lc.AddrsFactory = addrsFactory
+		return nil
+	}
 	return libp2p.New(
 		ctx,
 		libp2p.EnableAutoRelay(),
+		addrsFactoryOpt,
 		libp2p.Routing(makeDHTRightType),
+		libp2p.Filters(filters),
 		libp2p.ChainOptions(nc.Libp2pOpts...),
 	)
-}
\ No newline at end of file
+}
@@ -0,0 +1,527 @@
+package node
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/clock"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/net"
+	"github.com/filecoin-project/go-filecoin/net/pubsub"
+	"github.com/filecoin-project/go-filecoin/plumbing"
+	"github.com/filecoin-project/go-filecoin/plumbing/cfg"
+	"github.com/filecoin-project/go-filecoin/plumbing/cst"
+	"github.com/filecoin-project/go-filecoin/plumbing/dag"
+	"github.com/filecoin-project/go-filecoin/plumbing/msg"
+	"github.com/filecoin-project/go-filecoin/plumbing/strgdls"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/proofs/verification"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/util/moresync"
+	"github.com/filecoin-project/go-filecoin/version"
+	"github.com/filecoin-project/go-filecoin/wallet"
+	"github.com/ipfs/go-bitswap"
+	bsnet "github.com/ipfs/go-bitswap/network"
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-graphsync"
+	"github.com/ipfs/go-graphsync/ipldbridge"
+	gsnet "github.com/ipfs/go-graphsync/network"
+	gsstoreutil "github.com/ipfs/go-graphsync/storeutil"
+	"github.com/ipfs/go-hamt-ipld"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/ipfs/go-merkledag"
+	"github.com/libp2p/go-libp2p-core/host"
+	p2pmetrics "github.com/libp2p/go-libp2p-core/metrics"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/libp2p/go-libp2p-core/routing"
+	gorpc "github.com/libp2p/go-libp2p-gorpc"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	libp2pps "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	"github.com/pkg/errors"
+	"go.uber.org/fx"
+)
+
+// Options assembles the fx.Option graph that describes how to construct a
+// filecoin Node from a Config. Grouping mirrors the Node's natural
+// subsystems (repo, host+routing, blockstore+exchange, chain+message
+// stores, consensus, mempool/outbox, pubsub, porcelain/plumbing) so test
+// harnesses, relays and offline nodes can swap individual providers with
+// fx.Replace or fx.Decorate instead of rebuilding the whole graph.
+func Options(opts ...ConfigOpt) fx.Option {
+	return fx.Options(
+		fx.Provide(func() ([]ConfigOpt, error) { return opts, nil }),
+		fx.Provide(newConfig),
+		repoModule,
+		hostModule,
+		blockstoreModule,
+		chainModule,
+		consensusModule,
+		mempoolModule,
+		pubsubModule,
+		porcelainModule,
+		fx.Provide(assembleNode),
+	)
+}
+
+// Override replaces a single provider in the graph built by Options,
+// e.g. node.Override(new(consensus.Protocol), myConsensus) swaps out
+// whatever provides consensus.Protocol in favor of myConsensus. target
+// must be a non-nil pointer to the type being replaced (typically
+// new(T)); replacement must be assignable to that type. Test harnesses
+// use this to construct nodes with swapped-in subsystems.
+//
+// fx.Replace keys a replacement off its own concrete type, not the
+// interface target names, so fx.Annotate(replacement, fx.As(target)) is
+// required to make the graph's consumers of target's type actually pick
+// up replacement.
+func Override(target interface{}, replacement interface{}) fx.Option {
+	targetType := reflect.TypeOf(target)
+	if targetType == nil || targetType.Kind() != reflect.Ptr {
+		return fx.Error(errors.Errorf("node.Override: target must be a non-nil pointer, e.g. new(T); got %T", target))
+	}
+	targetType = targetType.Elem()
+
+	replacementType := reflect.TypeOf(replacement)
+	if replacementType == nil || !replacementType.AssignableTo(targetType) {
+		return fx.Error(errors.Errorf("node.Override: replacement of type %T is not assignable to target type %s", replacement, targetType))
+	}
+
+	return fx.Replace(fx.Annotate(replacement, fx.As(target)))
+}
+
+// FastSyncProtocol is the protocol.ID chain.SyncManager's gorpc client and
+// server register against.
+const FastSyncProtocol = protocol.ID(chain.FastSyncProtocol)
+
+func newConfig(opts []ConfigOpt) (*Config, error) {
+	n := &Config{}
+	for _, o := range opts {
+		if err := o(n); err != nil {
+			return nil, err
+		}
+	}
+	if n.Repo == nil {
+		n.Repo = repo.NewInMemoryRepo()
+	}
+	if n.Clock == nil {
+		n.Clock = clock.NewSystemClock()
+	}
+	return n, nil
+}
+
+// repoModule provides the repo, the clock, and the blockstore built on
+// the repo's datastore that everything downstream reads from.
+var repoModule = fx.Options(
+	fx.Provide(func(nc *Config) repo.Repo { return nc.Repo }),
+	fx.Provide(func(nc *Config) clock.Clock { return nc.Clock }),
+	fx.Provide(func(r repo.Repo) bstore.Blockstore { return bstore.NewBlockstore(r.Datastore()) }),
+)
+
+// hostModule provides the libp2p host and its routing table, along with
+// the peer tracker, peer manager and pinger that ride on top of it.
+var hostModule = fx.Options(
+	fx.Provide(newHostAndRouter),
+	fx.Provide(func(h host.Host) *ping.PingService { return ping.NewPingService(h) }),
+	fx.Provide(func() *net.PeerTracker { return net.NewPeerTracker() }),
+	fx.Provide(newPeerMgr),
+)
+
+type hostAndRouterOut struct {
+	fx.Out
+
+	Host             host.Host
+	Router           routing.Routing
+	BandwidthTracker *p2pmetrics.BandwidthCounter
+}
+
+func newHostAndRouter(lc fx.Lifecycle, nc *Config, r repo.Repo) (hostAndRouterOut, error) {
+	validator := blankValidator{}
+
+	h, router, bandwidthTracker, err := nc.buildHostAndRouter(context.Background(), validator)
+	if err != nil {
+		return hostAndRouterOut{}, err
+	}
+
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return h.Close()
+		},
+	})
+
+	return hostAndRouterOut{Host: h, Router: router, BandwidthTracker: bandwidthTracker}, nil
+}
+
+// newPeerMgr builds a PeerMgr on top of the DHT router, or returns nil
+// when the node is offline or configured with a non-DHT Routing: there is
+// no DHT to discover FilecoinDHT-speaking peers from in that case.
+func newPeerMgr(lc fx.Lifecycle, h host.Host, router routing.Routing, tracker *net.PeerTracker) *net.PeerMgr {
+	ipfsDHT, ok := router.(*dht.IpfsDHT)
+	if !ok {
+		return nil
+	}
+
+	pm := net.NewPeerMgr(h, ipfsDHT, tracker, net.PeerMgrConfig{
+		MinPeerThreshold: net.DefaultPeerMgrMinPeers,
+		MaxPeerThreshold: net.DefaultPeerMgrMaxPeers,
+	})
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			return pm.Run()
+		},
+		OnStop: func(ctx context.Context) error {
+			pm.Stop()
+			return nil
+		},
+	})
+
+	return pm
+}
+
+// blockstoreModule provides bitswap, graphsync and the fetcher built on
+// top of them.
+var blockstoreModule = fx.Options(
+	fx.Provide(newBitswap),
+	fx.Provide(newGraphsyncFetcher),
+	fx.Provide(func(nc *Config, clk clock.Clock) *consensus.DefaultBlockValidator {
+		return consensus.NewDefaultBlockValidator(nc.BlockTime, clk)
+	}),
+)
+
+func newBitswap(lc fx.Lifecycle, h host.Host, router routing.Routing, bs bstore.Blockstore) (*bitswap.Bitswap, bserv.BlockService) {
+	nwork := bsnet.NewFromIpfsHost(h, router)
+	bswap := bitswap.New(context.Background(), nwork, bs)
+	bservice := bserv.New(bs, bswap)
+
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return bswap.Close()
+		},
+	})
+
+	return bswap, bservice
+}
+
+func newGraphsyncFetcher(lc fx.Lifecycle, h host.Host, bs bstore.Blockstore, blkValid *consensus.DefaultBlockValidator, peerTracker *net.PeerTracker, peerMgr *net.PeerMgr) *net.GraphSyncFetcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	graphsyncNetwork := gsnet.NewFromLibp2pHost(h)
+	bridge := ipldbridge.NewIPLDBridge()
+	loader := gsstoreutil.LoaderForBlockstore(bs)
+	storer := gsstoreutil.StorerForBlockstore(bs)
+	gsync := graphsync.New(ctx, graphsyncNetwork, bridge, loader, storer)
+	fetcher := net.NewGraphSyncFetcher(ctx, gsync, bs, blkValid, peerTracker, peerMgr)
+
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+
+	return fetcher
+}
+
+// chainModule provides the cbor store, chain and message stores, the
+// chain state provider, the syncer, and the SyncManager that fast-syncs
+// it against a trusted bootstrap peer on startup.
+var chainModule = fx.Options(
+	fx.Provide(newChainStore),
+	fx.Provide(chain.NewMessageStore),
+	fx.Provide(cst.NewChainStateProvider),
+	fx.Provide(newChainSyncer),
+	fx.Provide(newSyncManager),
+)
+
+func newChainStore(nc *Config, r repo.Repo, bs bstore.Blockstore) (*hamt.CborIpldStore, *chain.Store, chain.StatusReporter, error) {
+	ipldCborStore := hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+	genCid, err := readGenesisCid(r.Datastore())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	reporter := chain.NewStatusReporter()
+	chainStore := chain.NewStore(r.ChainDatastore(), &ipldCborStore, &state.TreeStateLoader{}, reporter, genCid)
+
+	network, err := networkNameFromGenesis(context.Background(), chainStore, bs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if _, err := version.ConfigureProtocolVersions(network); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return &ipldCborStore, chainStore, reporter, nil
+}
+
+func newChainSyncer(cons consensus.Protocol, chainStore *chain.Store, messageStore *chain.MessageStore, fetcher *net.GraphSyncFetcher, reporter chain.StatusReporter, clk clock.Clock) *chain.Syncer {
+	return chain.NewSyncer(cons, chainStore, messageStore, fetcher, reporter, clk)
+}
+
+// newSyncManager wires up a chain.SyncManager against the first
+// configured bootstrap peer, serving FastSyncProtocol both ways so peers
+// syncing off this node get the same hash-chain-verified fast path. With
+// no bootstrap peer configured, the returned SyncManager still gets
+// Start/Stop hooks, but Start immediately marks the initial sync phase
+// complete since there is nothing to fast sync against.
+func newSyncManager(lc fx.Lifecycle, nc *Config, r repo.Repo, h host.Host, chainStore *chain.Store, chainSyncer *chain.Syncer, bs bstore.Blockstore) (*chain.SyncManager, error) {
+	rpcServer := gorpc.NewServer(h, FastSyncProtocol)
+	if err := rpcServer.Register(chain.NewSyncManagerRPC(chainStore)); err != nil {
+		return nil, errors.Wrap(err, "failed to register fast sync RPC handler")
+	}
+
+	ba := r.Config().Bootstrap.Addresses
+	bpi, err := net.PeerAddrsToAddrInfo(ba)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't parse bootstrap addresses [%s]", ba)
+	}
+
+	var sm *chain.SyncManager
+	if len(bpi) == 0 {
+		// No bootstrap peer configured: SyncManager.Start treats this as
+		// "nothing to fast sync", completing the initial sync phase
+		// synchronously rather than leaving it pending forever.
+		sm = chain.NewSyncManager(chainSyncer, chainStore, bs, "", nil, nc.Checkpoint)
+	} else {
+		for _, pi := range bpi {
+			h.Peerstore().AddAddrs(pi.ID, pi.Addrs, peerstore.PermanentAddrTTL)
+		}
+		rpcClient := gorpc.NewClient(h, FastSyncProtocol)
+		sm = chain.NewSyncManager(chainSyncer, chainStore, bs, bpi[0].ID, rpcClient, nc.Checkpoint)
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			sm.Start(ctx)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			sm.Stop()
+			return nil
+		},
+	})
+
+	return sm, nil
+}
+
+// consensusModule provides the message processor and the consensus
+// protocol implementation.
+var consensusModule = fx.Options(
+	fx.Provide(newProcessor),
+	fx.Provide(newConsensus),
+	fx.Provide(func() *consensus.MarketView { return &consensus.MarketView{} }),
+)
+
+func newProcessor(nc *Config) consensus.Processor {
+	if nc.Rewarder == nil {
+		return consensus.NewDefaultProcessor()
+	}
+	return consensus.NewConfiguredProcessor(consensus.NewDefaultMessageValidator(), nc.Rewarder)
+}
+
+func newConsensus(nc *Config, cborStore *hamt.CborIpldStore, bs bstore.Blockstore, processor consensus.Processor, blkValid *consensus.DefaultBlockValidator, powerTable *consensus.MarketView, chainStore *chain.Store) consensus.Protocol {
+	verifier := nc.Verifier
+	if verifier == nil {
+		verifier = &verification.RustVerifier{}
+	}
+	genCid := chainStore.GenesisCid()
+	return consensus.NewExpected(cborStore, bs, processor, blkValid, powerTable, genCid, verifier, nc.BlockTime)
+}
+
+// mempoolModule provides the wallet, the inbound message pool and the
+// outbox that publishes locally authored messages.
+var mempoolModule = fx.Options(
+	fx.Provide(newWallet),
+	fx.Provide(newMsgPool),
+	fx.Provide(newInbox),
+	fx.Provide(newOutbox),
+)
+
+func newWallet(r repo.Repo) (*wallet.Wallet, error) {
+	backend, err := wallet.NewDSBackend(r.WalletDatastore())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to set up wallet backend")
+	}
+	return wallet.New(backend), nil
+}
+
+func newMsgPool(r repo.Repo, chainState *cst.ChainStateProvider) *core.MessagePool {
+	return core.NewMessagePool(r.Config().Mpool, consensus.NewIngestionValidator(chainState, r.Config().Mpool))
+}
+
+func newInbox(msgPool *core.MessagePool, chainStore *chain.Store, messageStore *chain.MessageStore) *core.Inbox {
+	return core.NewInbox(msgPool, core.InboxMaxAgeTipsets, chainStore, messageStore)
+}
+
+func newOutbox(fcWallet *wallet.Wallet, messageStore *chain.MessageStore, chainStore *chain.Store, chainState *cst.ChainStateProvider, fsub *libp2pps.PubSub, msgPool *core.MessagePool) *core.Outbox {
+	msgQueue := core.NewMessageQueue()
+	outboxPolicy := core.NewMessageQueuePolicy(messageStore, core.OutboxMaxAgeRounds)
+	msgPublisher := core.NewDefaultMessagePublisher(pubsub.NewPublisher(fsub), net.MessageTopic, msgPool)
+	return core.NewOutbox(fcWallet, consensus.NewOutboundMessageValidator(), msgQueue, msgPublisher, outboxPolicy, chainStore, chainState)
+}
+
+// pubsubModule provides the gossipsub instance used for blocks and
+// messages, with block validation and peer-scoring wired in. Message
+// signing is left at gossipsub's default (on): an unsigned message is
+// simply another signal a scoring peer can hold against whoever relayed it.
+var pubsubModule = fx.Options(
+	fx.Provide(func() *net.PubsubScoreTracker { return net.NewPubsubScoreTracker() }),
+	fx.Provide(newPubSub),
+)
+
+func newPubSub(h host.Host, r repo.Repo, blkValid *consensus.DefaultBlockValidator, scoreTracker *net.PubsubScoreTracker) (*libp2pps.PubSub, error) {
+	btv := net.NewBlockTopicValidator(blkValid)
+	scoreParams, scoreThresholds := net.PubsubScoreParams(r.Config().Pubsub, btv.Topic())
+
+	fsub, err := libp2pps.NewGossipSub(
+		context.Background(),
+		h,
+		libp2pps.WithPeerScore(scoreParams, scoreThresholds),
+		libp2pps.WithPeerScoreInspect(scoreTracker.Inspect, 10*time.Second),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to set up network")
+	}
+	if err := fsub.RegisterTopicValidator(btv.Topic(), btv.Validator(), btv.Opts()...); err != nil {
+		return nil, errors.Wrap(err, "failed to register block validator")
+	}
+	return fsub, nil
+}
+
+// porcelainModule assembles the plumbing API dependencies and the
+// porcelain API that the RPC and CLI layers consume.
+var porcelainModule = fx.Options(
+	fx.Provide(newPorcelainAPI),
+	fx.Provide(newBootstrapper),
+)
+
+func newPorcelainAPI(
+	r repo.Repo,
+	h host.Host,
+	router routing.Routing,
+	fsub *libp2pps.PubSub,
+	bswap *bitswap.Bitswap,
+	bservice bserv.BlockService,
+	chainStore *chain.Store,
+	messageStore *chain.MessageStore,
+	chainState *cst.ChainStateProvider,
+	chainSyncer *chain.Syncer,
+	cons consensus.Protocol,
+	cborStore *hamt.CborIpldStore,
+	bs bstore.Blockstore,
+	msgPool *core.MessagePool,
+	outbox *core.Outbox,
+	fcWallet *wallet.Wallet,
+	bandwidthTracker *p2pmetrics.BandwidthCounter,
+	pingService *ping.PingService,
+	peerMgr *net.PeerMgr,
+	syncManager *chain.SyncManager,
+	pubsubScores *net.PubsubScoreTracker,
+) *porcelain.API {
+	return porcelain.New(plumbing.New(&plumbing.APIDeps{
+		Bitswap:      bswap,
+		Chain:        chainState,
+		Sync:         cst.NewChainSyncProvider(chainSyncer),
+		Config:       cfg.NewConfig(r),
+		DAG:          dag.NewDAG(merkledag.NewDAGService(bservice)),
+		Deals:        strgdls.New(r.DealsDatastore()),
+		Expected:     cons,
+		MsgPool:      msgPool,
+		MsgPreviewer: msg.NewPreviewer(chainStore, cborStore, bs),
+		MsgQueryer:   msg.NewQueryer(chainStore, cborStore, bs),
+		MsgWaiter:    msg.NewWaiter(chainStore, messageStore, bs, cborStore),
+		Network:      net.New(h, pubsub.NewPublisher(fsub), pubsub.NewSubscriber(fsub), net.NewRouter(router), bandwidthTracker, net.NewPinger(h, pingService)),
+		Outbox:       outbox,
+		PeerMgr:      peerMgr,
+		SyncManager:  syncManager,
+		PubsubScores: pubsubScores,
+		Wallet:       fcWallet,
+	}))
+}
+
+func newBootstrapper(lc fx.Lifecycle, r repo.Repo, h host.Host, router routing.Routing) (*net.Bootstrapper, error) {
+	periodStr := r.Config().Bootstrap.Period
+	period, err := parseBootstrapPeriod(periodStr)
+	if err != nil {
+		return nil, err
+	}
+
+	ba := r.Config().Bootstrap.Addresses
+	bpi, err := net.PeerAddrsToAddrInfo(ba)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't parse bootstrap addresses [%s]", ba)
+	}
+	minPeerThreshold := r.Config().Bootstrap.MinPeerThreshold
+	bootstrapper := net.NewBootstrapper(bpi, h, h.Network(), router, minPeerThreshold, period)
+
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			bootstrapper.Stop()
+			return nil
+		},
+	})
+
+	return bootstrapper, nil
+}
+
+// assembleNode wires every constructed subsystem into the final Node
+// struct. It registers no lifecycle hooks of its own: Node.Stop's single
+// app.Stop(ctx) call runs the OnStop hooks the individual providers
+// above registered.
+func assembleNode(
+	nc *Config,
+	r repo.Repo,
+	clk clock.Clock,
+	bs bstore.Blockstore,
+	cborStore *hamt.CborIpldStore,
+	h host.Host,
+	router routing.Routing,
+	peerTracker *net.PeerTracker,
+	fetcher *net.GraphSyncFetcher,
+	bswap *bitswap.Bitswap,
+	bservice bserv.BlockService,
+	chainStore *chain.Store,
+	messageStore *chain.MessageStore,
+	chainSyncer *chain.Syncer,
+	powerTable *consensus.MarketView,
+	cons consensus.Protocol,
+	inbox *core.Inbox,
+	outbox *core.Outbox,
+	fcWallet *wallet.Wallet,
+	porcelainAPI *porcelain.API,
+	bootstrapper *net.Bootstrapper,
+	syncManager *chain.SyncManager,
+) *Node {
+	return &Node{
+		blockservice: bservice,
+		Blockstore:   bs,
+		cborStore:    cborStore,
+		Clock:        clk,
+		Consensus:    cons,
+		ChainReader:  chainStore,
+		ChainSynced:  moresync.NewLatch(1),
+		MessageStore: messageStore,
+		Syncer:       chainSyncer,
+		PowerTable:   powerTable,
+		PeerTracker:  peerTracker,
+		Fetcher:      fetcher,
+		Exchange:     bswap,
+		host:         h,
+		Inbox:        inbox,
+		OfflineMode:  nc.OfflineMode,
+		Outbox:       outbox,
+		PeerHost:     h,
+		Repo:         r,
+		Wallet:       fcWallet,
+		Router:       router,
+		Bootstrapper: bootstrapper,
+		PorcelainAPI: porcelainAPI,
+		SyncManager:  syncManager,
+	}
+}
@@ -0,0 +1,61 @@
+package node
+
+import (
+	"testing"
+
+	"go.uber.org/fx"
+)
+
+type fxTestGreeter interface {
+	Greet() string
+}
+
+type fxTestRealGreeter struct{}
+
+func (fxTestRealGreeter) Greet() string { return "real" }
+
+type fxTestFakeGreeter struct{}
+
+func (fxTestFakeGreeter) Greet() string { return "fake" }
+
+// TestOverrideBindsToInterfaceType is a regression test: Override used to
+// validate target/replacement and then call fx.Replace(replacement),
+// which keys off replacement's own concrete type rather than the
+// interface target names, so the override silently had no effect on
+// anything depending on the target interface.
+func TestOverrideBindsToInterfaceType(t *testing.T) {
+	var got fxTestGreeter
+	app := fx.New(
+		fx.Provide(func() fxTestGreeter { return fxTestRealGreeter{} }),
+		Override(new(fxTestGreeter), fxTestFakeGreeter{}),
+		fx.Populate(&got),
+	)
+	if err := app.Err(); err != nil {
+		t.Fatalf("fx.New failed: %s", err)
+	}
+	if got.Greet() != "fake" {
+		t.Fatalf("expected Override to replace the fxTestGreeter provider, got %q", got.Greet())
+	}
+}
+
+func TestOverrideRejectsNonPointerTarget(t *testing.T) {
+	app := fx.New(
+		fx.Provide(func() fxTestGreeter { return fxTestRealGreeter{} }),
+		Override(fxTestFakeGreeter{}, fxTestFakeGreeter{}),
+		fx.Invoke(func(fxTestGreeter) {}),
+	)
+	if app.Err() == nil {
+		t.Fatal("expected Override with a non-pointer target to error")
+	}
+}
+
+func TestOverrideRejectsUnassignableReplacement(t *testing.T) {
+	app := fx.New(
+		fx.Provide(func() fxTestGreeter { return fxTestRealGreeter{} }),
+		Override(new(fxTestGreeter), 42),
+		fx.Invoke(func(fxTestGreeter) {}),
+	)
+	if app.Err() == nil {
+		t.Fatal("expected Override with an unassignable replacement to error")
+	}
+}
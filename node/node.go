@@ -0,0 +1,64 @@
+package node
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/clock"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/net"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/util/moresync"
+	"github.com/filecoin-project/go-filecoin/wallet"
+	"github.com/ipfs/go-bitswap"
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-hamt-ipld"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/routing"
+	"go.uber.org/fx"
+)
+
+// Node is a Filecoin node: the assembled set of subsystems built by
+// Options/NewWithOptions, wired together through fx.
+type Node struct {
+	Blockstore   bstore.Blockstore
+	Clock        clock.Clock
+	Consensus    consensus.Protocol
+	ChainReader  *chain.Store
+	ChainSynced  *moresync.Latch
+	MessageStore *chain.MessageStore
+	Syncer       *chain.Syncer
+	PowerTable   *consensus.MarketView
+	PeerTracker  *net.PeerTracker
+	Fetcher      *net.GraphSyncFetcher
+	Exchange     *bitswap.Bitswap
+	Inbox        *core.Inbox
+	OfflineMode  bool
+	Outbox       *core.Outbox
+	PeerHost     host.Host
+	Repo         repo.Repo
+	Wallet       *wallet.Wallet
+	Router       routing.Routing
+	Bootstrapper *net.Bootstrapper
+	PorcelainAPI *porcelain.API
+	SyncManager  *chain.SyncManager
+
+	blockservice bserv.BlockService
+	cborStore    *hamt.CborIpldStore
+	host         host.Host
+
+	// app is the fx.App built from this Node's dependency graph. Stop
+	// runs every fx.Lifecycle OnStop hook registered while building the
+	// Node (closing the host, stopping the PeerMgr and SyncManager
+	// background loops, etc.) through this single handle.
+	app *fx.App
+}
+
+// Stop shuts the node down by running fx's registered OnStop hooks in
+// reverse construction order.
+func (nd *Node) Stop(ctx context.Context) error {
+	return nd.app.Stop(ctx)
+}
@@ -0,0 +1,61 @@
+package plumbing
+
+import (
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/net"
+	"github.com/filecoin-project/go-filecoin/plumbing/cfg"
+	"github.com/filecoin-project/go-filecoin/plumbing/cst"
+	"github.com/filecoin-project/go-filecoin/plumbing/dag"
+	"github.com/filecoin-project/go-filecoin/plumbing/msg"
+	"github.com/filecoin-project/go-filecoin/plumbing/strgdls"
+	"github.com/filecoin-project/go-filecoin/wallet"
+	"github.com/ipfs/go-bitswap"
+)
+
+// APIDeps holds the concrete dependencies the plumbing API wraps. Each
+// exported field backs one or more porcelain-facing methods defined
+// throughout this package.
+type APIDeps struct {
+	Bitswap      *bitswap.Bitswap
+	Chain        *cst.ChainStateProvider
+	Sync         *cst.ChainSyncProvider
+	Config       *cfg.Config
+	DAG          *dag.DAG
+	Deals        *strgdls.Deals
+	Expected     consensus.Protocol
+	MsgPool      *core.MessagePool
+	MsgPreviewer *msg.Previewer
+	MsgQueryer   *msg.Queryer
+	MsgWaiter    *msg.Waiter
+	Network      *net.Network
+	Outbox       *core.Outbox
+	Wallet       *wallet.Wallet
+
+	// PeerMgr is nil when the node was built without one, e.g. in
+	// offline mode or with a non-DHT Routing.
+	PeerMgr *net.PeerMgr
+
+	// SyncManager may be nil, in which case ChainInitialSyncCompleted
+	// reports false. A node built by node.Options always sets it, with or
+	// without a fast-sync bootstrap peer configured.
+	SyncManager *chain.SyncManager
+
+	// PubsubScores may be nil, in which case NetworkPubsubScores returns
+	// nil. A node built by node.Options always sets it, offline mode
+	// included.
+	PubsubScores *net.PubsubScoreTracker
+}
+
+// API is the plumbing layer's aggregate API: a thin wrapper around
+// APIDeps whose fields it promotes directly, so the rest of this package
+// can implement porcelain-facing methods as plain methods on *API.
+type API struct {
+	*APIDeps
+}
+
+// New constructs a plumbing API over deps.
+func New(deps *APIDeps) *API {
+	return &API{APIDeps: deps}
+}
@@ -0,0 +1,14 @@
+package plumbing
+
+import "github.com/filecoin-project/go-filecoin/net"
+
+// NetworkPeerMgrStats returns the current peer counts, target bounds and
+// per-peer scores tracked by the node's PeerMgr. It returns a zero-value
+// snapshot when the node was built without a PeerMgr, e.g. in offline
+// mode or with a non-DHT Routing.
+func (api *API) NetworkPeerMgrStats() net.PeerMgrStats {
+	if api.PeerMgr == nil {
+		return net.PeerMgrStats{}
+	}
+	return api.PeerMgr.Stats()
+}
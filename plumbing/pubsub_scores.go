@@ -0,0 +1,13 @@
+package plumbing
+
+import "github.com/libp2p/go-libp2p-core/peer"
+
+// NetworkPubsubScores returns a snapshot of the node's current gossipsub
+// peer scores. It returns nil when the node was built without a
+// PubsubScores tracker.
+func (api *API) NetworkPubsubScores() map[peer.ID]float64 {
+	if api.PubsubScores == nil {
+		return nil
+	}
+	return api.PubsubScores.Scores()
+}
@@ -0,0 +1,10 @@
+package plumbing
+
+// ChainInitialSyncCompleted reports whether the node's chain.SyncManager
+// has finished its initial fast-sync attempt against the bootstrap peer.
+func (api *API) ChainInitialSyncCompleted() bool {
+	if api.SyncManager == nil {
+		return false
+	}
+	return api.SyncManager.InitialSyncCompleted()
+}
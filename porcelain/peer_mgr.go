@@ -0,0 +1,18 @@
+package porcelain
+
+import (
+	"github.com/filecoin-project/go-filecoin/net"
+)
+
+// swarmPeerMgrStatsPlumbing is the subset of plumbing the porcelain API
+// needs in order to report PeerMgr diagnostics.
+type swarmPeerMgrStatsPlumbing interface {
+	NetworkPeerMgrStats() net.PeerMgrStats
+}
+
+// SwarmPeerMgrStats returns the current filecoin peer counts, the
+// configured low/high watermarks, and per-peer scores tracked by the
+// node's PeerMgr.
+func (api *API) SwarmPeerMgrStats() net.PeerMgrStats {
+	return api.plumbing.(swarmPeerMgrStatsPlumbing).NetworkPeerMgrStats()
+}
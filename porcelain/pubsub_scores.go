@@ -0,0 +1,15 @@
+package porcelain
+
+import "github.com/libp2p/go-libp2p-core/peer"
+
+// swarmPubsubScoresPlumbing is the subset of plumbing the porcelain API
+// needs in order to report gossipsub peer scores.
+type swarmPubsubScoresPlumbing interface {
+	NetworkPubsubScores() map[peer.ID]float64
+}
+
+// SwarmPubsubScores returns a snapshot of the node's current gossipsub
+// peer scores, keyed by peer ID.
+func (api *API) SwarmPubsubScores() map[peer.ID]float64 {
+	return api.plumbing.(swarmPubsubScoresPlumbing).NetworkPubsubScores()
+}
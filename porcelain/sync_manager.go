@@ -0,0 +1,14 @@
+package porcelain
+
+// chainInitialSyncCompletedPlumbing is the subset of plumbing the
+// porcelain API needs to report SyncManager progress.
+type chainInitialSyncCompletedPlumbing interface {
+	ChainInitialSyncCompleted() bool
+}
+
+// ChainInitialSyncCompleted reports whether the node's initial
+// Merkle-proof-verified fast sync against its bootstrap peer has
+// finished.
+func (api *API) ChainInitialSyncCompleted() bool {
+	return api.plumbing.(chainInitialSyncCompletedPlumbing).ChainInitialSyncCompleted()
+}